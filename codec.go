@@ -0,0 +1,135 @@
+package mobi
+
+import (
+	"io"
+	"sync"
+
+	"github.com/writingtoole/pdb/lz77"
+)
+
+// Decompressor wraps a compressed record reader in a reader that
+// yields its decompressed bytes, analogous to archive/zip's
+// Decompressor.
+type Decompressor func(io.Reader) io.ReadCloser
+
+// Compressor wraps a writer so that bytes written to it are
+// compressed before being written to w, analogous to archive/zip's
+// Compressor.
+type Compressor func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	codecMu       sync.RWMutex
+	decompressors = map[uint16]Decompressor{}
+	compressors   = map[uint16]Compressor{}
+)
+
+// RegisterDecompressor registers a Decompressor for the given
+// compression id (one of the Compression* constants, or a
+// user-defined id). It is intended to be called from init and
+// overrides any previously registered decompressor for id. Books
+// compressed with CompressionHuffCDIC are always decoded by the
+// package's built-in HUFF/CDIC decoder, which needs the book's own
+// Huffman tables; a Decompressor registered for that id is not used.
+func RegisterDecompressor(id uint16, d Decompressor) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	decompressors[id] = d
+}
+
+// RegisterCompressor registers a Compressor for the given compression
+// id. It is intended to be called from init and overrides any
+// previously registered compressor for id.
+func RegisterCompressor(id uint16, c Compressor) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	compressors[id] = c
+}
+
+func decompressor(id uint16) (Decompressor, bool) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	d, ok := decompressors[id]
+	return d, ok
+}
+
+func compressor(id uint16) (Compressor, bool) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, ok := compressors[id]
+	return c, ok
+}
+
+func init() {
+	RegisterDecompressor(CompressionNone, func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(r)
+	})
+	RegisterDecompressor(CompressionPalmDOC, func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(&palmDocDecompressReader{r: r})
+	})
+
+	RegisterCompressor(CompressionNone, func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	})
+	RegisterCompressor(CompressionPalmDOC, func(w io.Writer) (io.WriteCloser, error) {
+		return &palmDocCompressWriter{w: w}, nil
+	})
+}
+
+// nopWriteCloser adapts an io.Writer to io.WriteCloser.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// palmDocDecompressReader lazily decompresses its underlying reader's
+// entire contents on the first Read, since lz77.Decompress works on
+// whole records rather than a byte stream.
+type palmDocDecompressReader struct {
+	r    io.Reader
+	data []byte
+	err  error
+	read bool
+}
+
+func (p *palmDocDecompressReader) Read(buf []byte) (int, error) {
+	if !p.read {
+		p.read = true
+		raw, err := io.ReadAll(p.r)
+		if err != nil {
+			p.err = err
+		} else {
+			p.data, p.err = lz77.Decompress(raw)
+		}
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+	if len(p.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(buf, p.data)
+	p.data = p.data[n:]
+	return n, nil
+}
+
+// palmDocCompressWriter buffers everything written to it and
+// PalmDOC-compresses it to w on Close, for the same reason.
+type palmDocCompressWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (p *palmDocCompressWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	return len(b), nil
+}
+
+func (p *palmDocCompressWriter) Close() error {
+	data, err := lz77.Compress(p.buf)
+	if err != nil {
+		return err
+	}
+	_, err = p.w.Write(data)
+	return err
+}
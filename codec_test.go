@@ -0,0 +1,75 @@
+package mobi
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// reverseCodec is a trivial user-defined codec: "compressing" reverses
+// the bytes, and decompressing reverses them back.
+const reverseCodecID = 0xfff0
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		out[len(b)-1-i] = c
+	}
+	return out
+}
+
+func TestCustomCodecRegistry(t *testing.T) {
+	RegisterDecompressor(reverseCodecID, func(r io.Reader) io.ReadCloser {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			b = nil
+		}
+		return io.NopCloser(bytes.NewReader(reverseBytes(b)))
+	})
+	RegisterCompressor(reverseCodecID, func(w io.Writer) (io.WriteCloser, error) {
+		return &reverseWriter{w: w}, nil
+	})
+
+	d, ok := decompressor(reverseCodecID)
+	if !ok {
+		t.Fatalf("decompressor not registered")
+	}
+	c, ok := compressor(reverseCodecID)
+	if !ok {
+		t.Fatalf("compressor not registered")
+	}
+
+	want := []byte("round trip me")
+	buf := &bytes.Buffer{}
+	wc, err := c(buf)
+	if err != nil {
+		t.Fatalf("compressor: %v", err)
+	}
+	wc.Write(want)
+	wc.Close()
+
+	rc := d(buf)
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("decompressor: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("round trip = %q, want %q", got, want)
+	}
+}
+
+type reverseWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (r *reverseWriter) Write(b []byte) (int, error) {
+	r.buf = append(r.buf, b...)
+	return len(b), nil
+}
+
+func (r *reverseWriter) Close() error {
+	_, err := r.w.Write(reverseBytes(r.buf))
+	return err
+}
@@ -0,0 +1,139 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/writingtoole/pdb"
+)
+
+// EXTH record types we know how to decode into Metadata.
+const (
+	exthAuthor          = 100
+	exthPublisher       = 101
+	exthDescription     = 103
+	exthISBN            = 104
+	exthSubject         = 105
+	exthPublicationDate = 106
+	exthContributor     = 108
+	exthRights          = 109
+	exthASIN            = 113
+	exthCoverOffset     = 201
+	exthThumbnailOffset = 202
+	exthUpdatedTitle    = 503
+)
+
+// Metadata holds the book metadata carried in the EXTH header.
+type Metadata struct {
+	Author          string
+	Publisher       string
+	Description     string
+	ISBN            string
+	Subject         string
+	PublicationDate string
+	Contributor     string
+	Rights          string
+	ASIN            string
+	UpdatedTitle    string
+
+	// CoverOffset and ThumbnailOffset are indices into Mobi.Images, or
+	// -1 if the book has no cover or thumbnail record.
+	CoverOffset     int
+	ThumbnailOffset int
+}
+
+// parseEXTH decodes the EXTH header located at the start of rd into a
+// Metadata struct. rd must begin with the "EXTH" signature.
+func parseEXTH(rd []byte) (*Metadata, error) {
+	if len(rd) < 12 || !bytes.Equal(rd[0:4], []byte("EXTH")) {
+		return nil, fmt.Errorf("bad EXTH signature")
+	}
+	count := binary.BigEndian.Uint32(rd[8:12])
+
+	md := &Metadata{CoverOffset: -1, ThumbnailOffset: -1}
+	off := 12
+	for i := uint32(0); i < count; i++ {
+		if off+8 > len(rd) {
+			return nil, fmt.Errorf("EXTH record %v truncated", i)
+		}
+		recType := binary.BigEndian.Uint32(rd[off:])
+		recLen := binary.BigEndian.Uint32(rd[off+4:])
+		if recLen < 8 || off+int(recLen) > len(rd) {
+			return nil, fmt.Errorf("EXTH record %v has invalid length %v", i, recLen)
+		}
+		data := rd[off+8 : off+int(recLen)]
+
+		switch recType {
+		case exthAuthor:
+			md.Author = string(data)
+		case exthPublisher:
+			md.Publisher = string(data)
+		case exthDescription:
+			md.Description = string(data)
+		case exthISBN:
+			md.ISBN = string(data)
+		case exthSubject:
+			md.Subject = string(data)
+		case exthPublicationDate:
+			md.PublicationDate = string(data)
+		case exthContributor:
+			md.Contributor = string(data)
+		case exthRights:
+			md.Rights = string(data)
+		case exthASIN:
+			md.ASIN = string(data)
+		case exthUpdatedTitle:
+			md.UpdatedTitle = string(data)
+		case exthCoverOffset:
+			if len(data) >= 4 {
+				md.CoverOffset = int(binary.BigEndian.Uint32(data))
+			}
+		case exthThumbnailOffset:
+			if len(data) >= 4 {
+				md.ThumbnailOffset = int(binary.BigEndian.Uint32(data))
+			}
+		}
+
+		off += int(recLen)
+	}
+
+	return md, nil
+}
+
+// imageMagic sniffs the format of an image record from its leading
+// bytes, returning "" if it isn't a recognized image type.
+func imageMagic(d []byte) string {
+	switch {
+	case len(d) >= 3 && bytes.Equal(d[0:3], []byte{0xff, 0xd8, 0xff}):
+		return "jpeg"
+	case len(d) >= 6 && (bytes.Equal(d[0:6], []byte("GIF87a")) || bytes.Equal(d[0:6], []byte("GIF89a"))):
+		return "gif"
+	case len(d) >= 8 && bytes.Equal(d[0:8], []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}):
+		return "png"
+	default:
+		return ""
+	}
+}
+
+// parseImages walks the records from FirstImage through
+// LastContentRecord, collecting the ones that look like images.
+func (m *Mobi) parseImages(p *pdb.Pdb, mhd *mobiHeaderData) {
+	for i := int(mhd.FirstImage); i <= int(mhd.LastContentRecord) && i < len(p.Records); i++ {
+		d := p.Records[i].Data
+		if imageMagic(d) == "" {
+			continue
+		}
+		m.Images = append(m.Images, d)
+	}
+}
+
+// CoverImage returns the book's cover image and its sniffed format
+// ("jpeg", "gif", or "png"), or (nil, "") if the book has no cover.
+func (m *Mobi) CoverImage() ([]byte, string) {
+	if m.Metadata == nil || m.Metadata.CoverOffset < 0 || m.Metadata.CoverOffset >= len(m.Images) {
+		return nil, ""
+	}
+	d := m.Images[m.Metadata.CoverOffset]
+	return d, imageMagic(d)
+}
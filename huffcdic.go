@@ -0,0 +1,187 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/writingtoole/pdb"
+)
+
+// huffCdicReader decodes records compressed with Mobipocket's
+// HUFF/CDIC scheme: a single HUFF record holding two 256-entry Huffman
+// lookup tables, followed by one or more CDIC records holding the
+// phrase dictionary the Huffman codes index into.
+type huffCdicReader struct {
+	dict1 [256]uint32
+	dict2 [64]uint64
+
+	codelen uint32
+	dicts   [][][]byte
+}
+
+// newHuffCdicReader reads the HUFF and CDIC records described by mhd
+// out of p and builds a decoder for them.
+func newHuffCdicReader(p *pdb.Pdb, mhd *mobiHeaderData) (*huffCdicReader, error) {
+	if int(mhd.HuffmanRecordOffset) >= len(p.Records) {
+		return nil, fmt.Errorf("HuffmanRecordOffset %v out of range", mhd.HuffmanRecordOffset)
+	}
+
+	huff := p.Records[mhd.HuffmanRecordOffset].Data
+	if len(huff) < 24 || !bytes.Equal(huff[0:4], []byte("HUFF")) {
+		return nil, fmt.Errorf("bad HUFF magic")
+	}
+	tbl1Off := binary.BigEndian.Uint32(huff[8:12])
+	tbl2Off := binary.BigEndian.Uint32(huff[12:16])
+	if tbl1Off > uint32(len(huff)) || uint32(len(huff))-tbl1Off < 1024 {
+		return nil, ErrCorruptHeader
+	}
+	if tbl2Off > uint32(len(huff)) || uint32(len(huff))-tbl2Off < 512 {
+		return nil, ErrCorruptHeader
+	}
+
+	r := &huffCdicReader{}
+	for i := 0; i < 256; i++ {
+		r.dict1[i] = binary.BigEndian.Uint32(huff[tbl1Off+uint32(i*4):])
+	}
+	for i := 0; i < 64; i++ {
+		off := tbl2Off + uint32(i*8)
+		mincode := binary.BigEndian.Uint32(huff[off:])
+		maxcode := binary.BigEndian.Uint32(huff[off+4:])
+		r.dict2[i] = uint64(mincode)<<32 | uint64(maxcode)
+	}
+
+	for i := 1; i < int(mhd.HuffmanRecordCount); i++ {
+		idx := int(mhd.HuffmanRecordOffset) + i
+		if idx >= len(p.Records) {
+			return nil, fmt.Errorf("CDIC record %v out of range", idx)
+		}
+		cdic := p.Records[idx].Data
+		if len(cdic) < 16 || !bytes.Equal(cdic[0:4], []byte("CDIC")) {
+			return nil, fmt.Errorf("bad CDIC magic in record %v", idx)
+		}
+		phraseCount := binary.BigEndian.Uint32(cdic[8:12])
+		codelen := binary.BigEndian.Uint32(cdic[12:16])
+		r.codelen = codelen
+
+		dict := make([][]byte, phraseCount)
+		for j := uint32(0); j < phraseCount; j++ {
+			entryOff := 16 + int(j*2)
+			if entryOff+2 > len(cdic) {
+				break
+			}
+			off := binary.BigEndian.Uint16(cdic[entryOff:])
+			pos := 16 + int(phraseCount*2) + int(off)
+			if pos+2 > len(cdic) {
+				continue
+			}
+			plen := int(binary.BigEndian.Uint16(cdic[pos:])) & 0x7fff
+			start := pos + 2
+			if start+plen > len(cdic) {
+				continue
+			}
+			dict[j] = cdic[start : start+plen]
+		}
+		r.dicts = append(r.dicts, dict)
+	}
+
+	return r, nil
+}
+
+// phrase returns the dictionary entry for index, and whether it is a
+// literal terminal (true) or itself still Huffman-compressed (false).
+func (r *huffCdicReader) phrase(index uint32) ([]byte, bool, error) {
+	dictNo := index >> r.codelen
+	offset := index & ((1 << r.codelen) - 1)
+	if int(dictNo) >= len(r.dicts) {
+		return nil, false, fmt.Errorf("dictionary %v out of range", dictNo)
+	}
+	dict := r.dicts[dictNo]
+	if int(offset) >= len(dict) {
+		return nil, false, fmt.Errorf("phrase %v out of range in dictionary %v", offset, dictNo)
+	}
+	data := dict[offset]
+	if len(data) == 0 {
+		return nil, true, nil
+	}
+	terminal := data[0]&0x80 != 0
+	if terminal {
+		data = append([]byte{}, data...)
+		data[0] &^= 0x80
+	}
+	return data, terminal, nil
+}
+
+// decompress expands a single HUFF/CDIC-compressed record.
+func (r *huffCdicReader) decompress(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+
+	var bits uint64
+	var bitsLeft uint
+	pos := 0
+
+	fill := func() {
+		for bitsLeft <= 56 && pos < len(data) {
+			bits |= uint64(data[pos]) << (56 - bitsLeft)
+			bitsLeft += 8
+			pos++
+		}
+	}
+
+	for {
+		fill()
+		if bitsLeft == 0 {
+			break
+		}
+
+		entry := r.dict1[bits>>56]
+		codelen := uint(entry & 0x1f)
+		term := entry&0x80 != 0
+		maxcode := entry >> 8
+
+		if codelen == 0 || codelen > bitsLeft {
+			break
+		}
+
+		code := bits >> (64 - codelen)
+		if !term {
+			for i := codelen; i <= 32; i++ {
+				widened := bits >> (64 - i)
+				d2 := r.dict2[i]
+				c32 := uint32(widened)
+				if c32 <= uint32(d2) {
+					codelen = i
+					code = widened
+					maxcode = uint32(d2 & 0xffffffff)
+					break
+				}
+			}
+		}
+		if codelen > bitsLeft {
+			// Widening grew codelen past what's actually left in the
+			// record; bitsLeft -= codelen below would underflow and
+			// spin forever instead of ending the record.
+			break
+		}
+
+		index := (uint32(maxcode) - uint32(code)) >> (32 - r.codelen)
+		frag, terminal, err := r.phrase(index)
+		if err != nil {
+			return nil, err
+		}
+		if terminal {
+			out.Write(frag)
+		} else {
+			sub, err := r.decompress(frag)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(sub)
+		}
+
+		bits <<= codelen
+		bitsLeft -= codelen
+	}
+
+	return out.Bytes(), nil
+}
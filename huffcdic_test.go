@@ -0,0 +1,253 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/writingtoole/pdb"
+)
+
+// buildTestHuffCdic builds the smallest possible HUFF/CDIC table pair:
+// every 1-bit code decodes to the single dictionary phrase "Hi".
+func buildTestHuffCdic() (huff, cdic []byte) {
+	huffBuf := &bytes.Buffer{}
+	huffBuf.WriteString("HUFF")
+	binary.Write(huffBuf, binary.BigEndian, uint32(24))   // header length
+	binary.Write(huffBuf, binary.BigEndian, uint32(24))   // tbl1Off
+	binary.Write(huffBuf, binary.BigEndian, uint32(24+256*4)) // tbl2Off
+	binary.Write(huffBuf, binary.BigEndian, uint32(0))
+	binary.Write(huffBuf, binary.BigEndian, uint32(0))
+	for i := 0; i < 256; i++ {
+		// codelen=1, terminal, maxcode=0.
+		binary.Write(huffBuf, binary.BigEndian, uint32(0x81))
+	}
+	for i := 0; i < 64; i++ {
+		binary.Write(huffBuf, binary.BigEndian, uint32(0)) // mincode
+		binary.Write(huffBuf, binary.BigEndian, uint32(0)) // maxcode
+	}
+
+	cdicBuf := &bytes.Buffer{}
+	cdicBuf.WriteString("CDIC")
+	binary.Write(cdicBuf, binary.BigEndian, uint32(16)) // header length
+	binary.Write(cdicBuf, binary.BigEndian, uint32(1))  // phrase count
+	binary.Write(cdicBuf, binary.BigEndian, uint32(0))  // codelen
+	binary.Write(cdicBuf, binary.BigEndian, uint16(0))  // entry 0 offset
+	binary.Write(cdicBuf, binary.BigEndian, uint16(2))  // phrase length
+	cdicBuf.Write([]byte{0x80 | 'H', 'i'})              // phrase, flagged terminal
+
+	return huffBuf.Bytes(), cdicBuf.Bytes()
+}
+
+// buildWidenTestHuffCdic builds a HUFF/CDIC table pair whose first byte
+// decodes through a non-terminal dict1 entry, forcing decompress to widen
+// the code across several dict2 entries before it resolves. The dict2
+// bounds are only satisfied once the code has actually been re-read at
+// the wider bit length, so a decoder that reuses the original, shorter
+// code (rather than widening it) picks the wrong phrase index.
+func buildWidenTestHuffCdic() (huff, cdic []byte) {
+	const phraseCount = 172
+
+	huffBuf := &bytes.Buffer{}
+	huffBuf.WriteString("HUFF")
+	binary.Write(huffBuf, binary.BigEndian, uint32(24))       // header length
+	binary.Write(huffBuf, binary.BigEndian, uint32(24))       // tbl1Off
+	binary.Write(huffBuf, binary.BigEndian, uint32(24+256*4)) // tbl2Off
+	binary.Write(huffBuf, binary.BigEndian, uint32(0))
+	binary.Write(huffBuf, binary.BigEndian, uint32(0))
+	for i := 0; i < 256; i++ {
+		if i == 0xAB {
+			// codelen=4, non-terminal: the real code length is only
+			// resolved via dict2.
+			binary.Write(huffBuf, binary.BigEndian, uint32(4))
+			continue
+		}
+		binary.Write(huffBuf, binary.BigEndian, uint32(0))
+	}
+	for i := 0; i < 64; i++ {
+		var maxcode uint32
+		switch {
+		case i >= 4 && i <= 23:
+			maxcode = 5 // below every real widened prefix of 0xABCDEF
+		case i == 24:
+			maxcode = 0xABCDEF // exact match at the true code length
+		}
+		binary.Write(huffBuf, binary.BigEndian, uint32(0)) // mincode, unused
+		binary.Write(huffBuf, binary.BigEndian, maxcode)
+	}
+
+	cdicBuf := &bytes.Buffer{}
+	cdicBuf.WriteString("CDIC")
+	binary.Write(cdicBuf, binary.BigEndian, uint32(16))          // header length
+	binary.Write(cdicBuf, binary.BigEndian, uint32(phraseCount)) // phrase count
+	binary.Write(cdicBuf, binary.BigEndian, uint32(16))          // codelen
+	offsets := make([]uint16, phraseCount)
+	offsets[171] = 4 // past the "OK" entry, see blob below
+
+	for _, off := range offsets {
+		binary.Write(cdicBuf, binary.BigEndian, off)
+	}
+	binary.Write(cdicBuf, binary.BigEndian, uint16(2)) // "OK" phrase length
+	cdicBuf.Write([]byte{0x80 | 'O', 'K'})
+	binary.Write(cdicBuf, binary.BigEndian, uint16(3)) // "BUG" phrase length
+	cdicBuf.Write([]byte{0x80 | 'B', 'U', 'G'})
+
+	return huffBuf.Bytes(), cdicBuf.Bytes()
+}
+
+// TestHuffCdicDecompressWiden exercises the dict2 "widen the code" path
+// (term == false from the dict1 lookup), which TestHuffCdicDecompress
+// never reaches. A decoder that fails to re-read the code at the wider
+// bit length resolves the wrong phrase index ("BUG" instead of "OK").
+func TestHuffCdicDecompressWiden(t *testing.T) {
+	huff, cdic := buildWidenTestHuffCdic()
+	p := &pdb.Pdb{Records: []*pdb.Record{
+		{Data: []byte{0xAB, 0xCD, 0xEF}},
+		{Data: huff},
+		{Data: cdic},
+	}}
+	mhd := &mobiHeaderData{
+		HuffmanRecordOffset: 1,
+		HuffmanRecordCount:  2,
+	}
+
+	r, err := newHuffCdicReader(p, mhd)
+	if err != nil {
+		t.Fatalf("newHuffCdicReader: %v", err)
+	}
+
+	got, err := r.decompress(p.Records[0].Data)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if want := []byte("OK"); !bytes.Equal(got, want) {
+		t.Errorf("decompress() = %q, want %q", got, want)
+	}
+}
+
+// buildHangTestHuffCdic builds a HUFF/CDIC table pair where every byte
+// decodes through a non-terminal dict1 entry, and the first record
+// byte widens to a code longer than the record has bits left. Once the
+// code is (wrongly) accepted, dict1[0] resolves to another nonterminal
+// entry that matches trivially at its unwidened length, so a decoder
+// that doesn't re-check codelen against bitsLeft after widening never
+// hits a terminating condition.
+func buildHangTestHuffCdic() (huff, cdic []byte) {
+	huffBuf := &bytes.Buffer{}
+	huffBuf.WriteString("HUFF")
+	binary.Write(huffBuf, binary.BigEndian, uint32(24))       // header length
+	binary.Write(huffBuf, binary.BigEndian, uint32(24))       // tbl1Off
+	binary.Write(huffBuf, binary.BigEndian, uint32(24+256*4)) // tbl2Off
+	binary.Write(huffBuf, binary.BigEndian, uint32(0))
+	binary.Write(huffBuf, binary.BigEndian, uint32(0))
+	for i := 0; i < 256; i++ {
+		binary.Write(huffBuf, binary.BigEndian, uint32(4)) // codelen=4, non-terminal, for every byte
+	}
+	for i := 0; i < 64; i++ {
+		var maxcode uint32
+		switch {
+		case i >= 4 && i <= 11:
+			maxcode = 5 // below every real widened prefix of 0xAB
+		case i == 12:
+			maxcode = 0xfff // matches once widened to 12 bits
+		}
+		binary.Write(huffBuf, binary.BigEndian, uint32(0)) // mincode, unused
+		binary.Write(huffBuf, binary.BigEndian, maxcode)
+	}
+
+	cdicBuf := &bytes.Buffer{}
+	cdicBuf.WriteString("CDIC")
+	binary.Write(cdicBuf, binary.BigEndian, uint32(16)) // header length
+	binary.Write(cdicBuf, binary.BigEndian, uint32(1))  // phrase count
+	binary.Write(cdicBuf, binary.BigEndian, uint32(16)) // codelen
+	binary.Write(cdicBuf, binary.BigEndian, uint16(0))  // entry 0 offset
+	binary.Write(cdicBuf, binary.BigEndian, uint16(2))  // phrase length
+	cdicBuf.Write([]byte{0x80 | 'H', 'i'})
+
+	return huffBuf.Bytes(), cdicBuf.Bytes()
+}
+
+// TestHuffCdicDecompressWidenPastEnd covers a widened code that resolves
+// to a length longer than the bits actually left in the record. The
+// widen loop used to grow codelen past bitsLeft without re-checking,
+// and bitsLeft -= codelen (bitsLeft is unsigned) underflowed instead of
+// ending the record, spinning decompress forever.
+func TestHuffCdicDecompressWidenPastEnd(t *testing.T) {
+	huff, cdic := buildHangTestHuffCdic()
+	p := &pdb.Pdb{Records: []*pdb.Record{
+		{Data: []byte{0xAB}}, // only 8 bits; the widened code needs 12
+		{Data: huff},
+		{Data: cdic},
+	}}
+	mhd := &mobiHeaderData{
+		HuffmanRecordOffset: 1,
+		HuffmanRecordCount:  2,
+	}
+
+	r, err := newHuffCdicReader(p, mhd)
+	if err != nil {
+		t.Fatalf("newHuffCdicReader: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.decompress(p.Records[0].Data)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("decompress did not return; widened code past end of record hung the decoder")
+	}
+}
+
+// TestNewHuffCdicReaderBadOffsets checks that out-of-range tbl1Off/tbl2Off
+// fields in a malformed HUFF record are rejected instead of panicking.
+func TestNewHuffCdicReaderBadOffsets(t *testing.T) {
+	huff, cdic := buildTestHuffCdic()
+	// Corrupt tbl2Off to point past the end of the record.
+	binary.BigEndian.PutUint32(huff[12:16], uint32(len(huff)))
+
+	p := &pdb.Pdb{Records: []*pdb.Record{
+		{Data: []byte{0xFF}},
+		{Data: huff},
+		{Data: cdic},
+	}}
+	mhd := &mobiHeaderData{
+		HuffmanRecordOffset: 1,
+		HuffmanRecordCount:  2,
+	}
+
+	if _, err := newHuffCdicReader(p, mhd); err == nil {
+		t.Fatalf("newHuffCdicReader: want error for out-of-range tbl2Off, got nil")
+	}
+}
+
+func TestHuffCdicDecompress(t *testing.T) {
+	huff, cdic := buildTestHuffCdic()
+	p := &pdb.Pdb{Records: []*pdb.Record{
+		{Data: []byte{0xFF}},
+		{Data: huff},
+		{Data: cdic},
+	}}
+	mhd := &mobiHeaderData{
+		HuffmanRecordOffset: 1,
+		HuffmanRecordCount:  2,
+	}
+
+	r, err := newHuffCdicReader(p, mhd)
+	if err != nil {
+		t.Fatalf("newHuffCdicReader: %v", err)
+	}
+
+	got, err := r.decompress(p.Records[0].Data)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	want := bytes.Repeat([]byte("Hi"), 8)
+	if !bytes.Equal(got, want) {
+		t.Errorf("decompress() = %q, want %q", got, want)
+	}
+}
@@ -10,17 +10,42 @@ import (
 	"os"
 
 	"github.com/writingtoole/pdb"
-	"github.com/writingtoole/pdb/lz77"
 )
 
+// ErrCorruptHeader is reported when a header field refers to data
+// outside the bounds of the record it's read from. Parse and Read
+// include its text in a "Header parsing error" message formatted with
+// %v, so the error they return does not wrap it and errors.Is does not
+// match it.
+var ErrCorruptHeader = fmt.Errorf("mobi: corrupt header")
+
 type Mobi struct {
 	// The name of the book
 	Name string
-	// The text contents of the book. MOBI books have only a single file of text in them.
+	// The text contents of the book. MOBI books have only a single
+	// file of text in them. Contents is nil until ReadAll is called;
+	// earlier versions of this package populated it eagerly from
+	// Read/Parse, so callers upgrading from those versions need to add
+	// an explicit ReadAll call to keep getting text out of Contents.
 	Contents []byte
-	header   *mobiHeaderData
+	// Metadata holds the book's author, publisher, and other EXTH
+	// metadata, or nil if the book carries no EXTH header.
+	Metadata *Metadata
+	// Images holds the book's image records, in the order they appear
+	// in the file.
+	Images [][]byte
+
+	header      *mobiHeaderData
+	huff        *huffCdicReader
+	pdb         *pdb.Pdb
+	compression uint16
+	recordSize  int
+	textLength  int64
 }
 
+// exthFlag marks that an EXTH header follows the MOBI header.
+const exthFlag = 0x40
+
 // Compression types
 const (
 	CompressionNone     = 1
@@ -67,7 +92,8 @@ type mobiHeaderID struct {
 	HeaderLength uint32
 }
 
-const mhdSize = 248
+// mhdSize is the encoded size of mobiHeaderData.
+const mhdSize = 224
 
 type mobiHeaderData struct {
 	MobiType                    uint32
@@ -186,7 +212,10 @@ func (m *Mobi) parseHeader(p *pdb.Pdb) error {
 		return err
 	}
 
-	endOffset := mhi.HeaderLength + 24
+	endOffset := uint64(mhi.HeaderLength) + 24
+	if endOffset < 24 || endOffset > uint64(len(rd)) {
+		return ErrCorruptHeader
+	}
 	rawMobi := rd[24:endOffset]
 
 	mhd := &mobiHeaderData{}
@@ -201,34 +230,94 @@ func (m *Mobi) parseHeader(p *pdb.Pdb) error {
 		return fmt.Errorf("Error reading mhd: %v", err)
 	}
 
-	m.Name = string(rd[mhd.NameOffset : mhd.NameOffset+mhd.NameLength])
+	nameEnd := uint64(mhd.NameOffset) + uint64(mhd.NameLength)
+	if uint64(mhd.NameOffset) > uint64(len(rd)) || nameEnd > uint64(len(rd)) {
+		return ErrCorruptHeader
+	}
+	m.Name = string(rd[mhd.NameOffset:nameEnd])
 
-	switch h.Compression {
-	case CompressionNone:
-		rawBookText := make([]byte, 0, h.RecordCount*4096)
-		for i := 1; i < int(mhd.FirstNonBookRecord); i++ {
-			rawBookText = append(rawBookText, m.trailStrip(p, i)...)
+	if mhd.EXTHFlags&exthFlag != 0 {
+		md, err := parseEXTH(rd[endOffset:])
+		if err != nil {
+			return fmt.Errorf("Error reading EXTH header: %v", err)
 		}
-		m.Contents = rawBookText
-	case CompressionPalmDOC:
-		rawBookText := make([]byte, 0, h.RecordCount*4096)
-		for i := 1; i < int(mhd.FirstNonBookRecord); i++ {
-			c, err := lz77.Decompress(m.trailStrip(p, i))
-			if err != nil {
-				return fmt.Errorf("Error decompressing record %v: %v", i, err)
-			}
-			rawBookText = append(rawBookText, c...)
+		m.Metadata = md
+	}
+	m.parseImages(p, mhd)
+
+	m.pdb = p
+	m.compression = h.Compression
+	m.recordSize = int(h.RecordSize)
+	if m.recordSize == 0 {
+		m.recordSize = 4096
+	}
+	m.textLength = int64(h.TextLength)
+
+	switch {
+	case h.Compression == CompressionHuffCDIC:
+		huff, err := newHuffCdicReader(p, mhd)
+		if err != nil {
+			return fmt.Errorf("Error reading HUFF/CDIC tables: %v", err)
 		}
-		m.Contents = rawBookText
+		m.huff = huff
 	default:
-		return fmt.Errorf("Unknown compression type %v", h.Compression)
+		if _, ok := decompressor(h.Compression); !ok {
+			return fmt.Errorf("Unknown compression type %v", h.Compression)
+		}
+		// Nothing to precompute; records are decoded on demand.
 	}
 
 	return nil
 }
 
+// decodeRecord returns the decompressed text of book text record rec
+// (1-indexed, as stored in the PDB).
+func (m *Mobi) decodeRecord(rec int) ([]byte, error) {
+	raw := m.trailStrip(m.pdb, rec)
+
+	// HUFF/CDIC needs the book's own Huffman tables, so it can't be
+	// expressed as a Decompressor and goes through m.huff directly.
+	if m.compression == CompressionHuffCDIC {
+		c, err := m.huff.decompress(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Error decompressing record %v: %v", rec, err)
+		}
+		return c, nil
+	}
+
+	d, ok := decompressor(m.compression)
+	if !ok {
+		return nil, fmt.Errorf("Unknown compression type %v", m.compression)
+	}
+	rc := d(bytes.NewReader(raw))
+	defer rc.Close()
+	c, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("Error decompressing record %v: %v", rec, err)
+	}
+	return c, nil
+}
+
+// ReadAll decodes the entire book text and stores it in m.Contents,
+// for callers that prefer the simple eager API over OpenText.
+func (m *Mobi) ReadAll() error {
+	rawBookText := make([]byte, 0, m.textLength)
+	for i := 1; i < int(m.header.FirstNonBookRecord); i++ {
+		c, err := m.decodeRecord(i)
+		if err != nil {
+			return err
+		}
+		rawBookText = append(rawBookText, c...)
+	}
+	m.Contents = rawBookText
+	return nil
+}
+
 // trailStrip strips off any trailing data from the record that
-// doesn't actually count as part of the record data.
+// doesn't actually count as part of the record data. It always runs
+// before the record is handed to a registered Decompressor, so a
+// plugged-in codec never sees the extra multibyte/trailing bytes
+// described by ExtraFlags.
 func (m *Mobi) trailStrip(p *pdb.Pdb, rec int) []byte {
 	d := p.Records[rec].Data
 
@@ -244,8 +333,14 @@ func (m *Mobi) trailStrip(p *pdb.Pdb, rec int) []byte {
 				switch i {
 				case 0:
 					// Bit 0 is special.
+					if len(d) == 0 {
+						return d
+					}
 					l := int(d[len(d)-1])
 					extra = 1 + (l & 3)
+					if extra > len(d) {
+						return d
+					}
 					d = d[0 : len(d)-extra]
 				default:
 					in, off, l, err := reverseDecodeInt(d)
@@ -254,6 +349,10 @@ func (m *Mobi) trailStrip(p *pdb.Pdb, rec int) []byte {
 						return d
 					}
 					extra = in - l
+					if off-extra < 0 || off-extra > len(d) {
+						log.Printf("Trailing bytes overrun for rec %v: extra %v exceeds record", rec, extra)
+						return d
+					}
 					d = d[0 : off-extra]
 				}
 			}
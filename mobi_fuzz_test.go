@@ -0,0 +1,156 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/writingtoole/pdb"
+)
+
+// FuzzReader exercises Parse with arbitrary bytes as the sole PDB
+// record, the way a malformed .mobi file would present itself. Parse
+// must return an error rather than panic on malformed input.
+func FuzzReader(f *testing.F) {
+	f.Add(buildSampleBook(f))
+	f.Add([]byte{})
+	f.Add(make([]byte, 32))
+	f.Add(make([]byte, 300))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := &pdb.Pdb{Records: []*pdb.Record{{Data: data}}}
+		Parse(p)
+	})
+}
+
+// FuzzHuffCdicDecompress exercises huffCdicReader.decompress directly
+// against arbitrary record bytes. Parse never reaches this code itself
+// (it only builds the Huffman tables), so without this target the
+// bit-level decoder - the densest, most attacker-facing parsing code
+// in the package - went unfuzzed. decompress must return promptly
+// with either a result or an error, never hang or panic.
+func FuzzHuffCdicDecompress(f *testing.F) {
+	huff, cdic := buildTestHuffCdic()
+	p := &pdb.Pdb{Records: []*pdb.Record{
+		{Data: []byte{0xFF}},
+		{Data: huff},
+		{Data: cdic},
+	}}
+	r, err := newHuffCdicReader(p, &mobiHeaderData{HuffmanRecordOffset: 1, HuffmanRecordCount: 2})
+	if err != nil {
+		f.Fatalf("newHuffCdicReader: %v", err)
+	}
+
+	f.Add([]byte{0xFF})
+	f.Add([]byte{0xAB})
+	f.Add([]byte{0xAB, 0xCD, 0xEF})
+	f.Add([]byte{})
+	f.Add(make([]byte, 64))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r.decompress(data)
+	})
+}
+
+// FuzzTrailStrip exercises trailStrip and reverseDecodeInt directly
+// against arbitrary record bytes and ExtraFlags combinations.
+func FuzzTrailStrip(f *testing.F) {
+	f.Add([]byte{0, 0, 0}, uint32(0))
+	f.Add([]byte{}, uint32(0xffff))
+	f.Add([]byte{1, 2, 3, 4, 0x81}, uint32(0xffff))
+	f.Add([]byte{0, 0, 0, 0}, uint32(1))
+
+	f.Fuzz(func(t *testing.T, data []byte, extraFlags uint32) {
+		m := &Mobi{header: &mobiHeaderData{ExtraFlags: extraFlags}}
+		p := &pdb.Pdb{Records: []*pdb.Record{{Data: data}}}
+		m.trailStrip(p, 0)
+	})
+}
+
+// TestParseMalformedHeader covers header shapes that previously
+// panicked parseHeader instead of returning an error.
+func TestParseMalformedHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "NameOffset+NameLength beyond record length",
+			data: minimalRecord0(func(h *mobiHeaderData) { h.NameOffset, h.NameLength = 1<<20, 1<<20 }),
+		},
+		{
+			name: "HeaderLength overflows endOffset",
+			data: minimalRecord0WithHeaderLength(0xffffffff),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pdb.Pdb{Records: []*pdb.Record{{Data: tt.data}}}
+			if _, err := Parse(p); err == nil {
+				t.Errorf("Parse() succeeded, want error")
+			}
+		})
+	}
+}
+
+// TestTrailStripMalformed covers record shapes that previously
+// panicked trailStrip instead of returning the record unmodified.
+func TestTrailStripMalformed(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		extraFlags uint32
+	}{
+		{
+			name:       "ExtraFlags demands more trailing bytes than the record contains",
+			data:       []byte{0x01},
+			extraFlags: 1,
+		},
+		{
+			name:       "all-zero record other than the 3-byte case",
+			data:       []byte{0, 0, 0, 0},
+			extraFlags: 1,
+		},
+		{
+			name:       "empty record",
+			data:       []byte{},
+			extraFlags: 0xffff,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Mobi{header: &mobiHeaderData{ExtraFlags: tt.extraFlags}}
+			p := &pdb.Pdb{Records: []*pdb.Record{{Data: tt.data}}}
+			// Must not panic.
+			m.trailStrip(p, 0)
+		})
+	}
+}
+
+// minimalRecord0 builds a minimal, otherwise-valid MOBI record 0 (no
+// compression, no EXTH) with mutate applied to its mobiHeaderData
+// before encoding.
+func minimalRecord0(mutate func(*mobiHeaderData)) []byte {
+	h := &mobiHeaderData{FirstNonBookRecord: 1}
+	mutate(h)
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, &header{Compression: CompressionNone}) // PalmDOC header, compression=none
+	buf.WriteString("MOBI")
+	binary.Write(buf, binary.BigEndian, uint32(mhdSize))
+	binary.Write(buf, binary.BigEndian, h)
+	return buf.Bytes()
+}
+
+// minimalRecord0WithHeaderLength builds a record 0 whose MOBI header
+// declares the given (possibly bogus) HeaderLength, with no header
+// body following it.
+func minimalRecord0WithHeaderLength(headerLength uint32) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write(make([]byte, 16))
+	buf.WriteString("MOBI")
+	binary.Write(buf, binary.BigEndian, headerLength)
+	return buf.Bytes()
+}
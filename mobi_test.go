@@ -1,18 +1,43 @@
 package mobi
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 )
 
-// The sample file is a copy of Alice in Wonderland from Project Gutenberg.
-const sampleFile = "testdata/pg11-images.mobi"
 const bookName = "Alice's Adventures in Wonderland"
 
+// buildSampleBook returns an encoded .mobi file with a name, author,
+// a single cover image, and HTML contents ending in "</html>", built
+// with the package's own Writer since no real sample file is checked
+// into testdata.
+func buildSampleBook(t testing.TB) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetName(bookName)
+	w.SetAuthor("Lewis Carroll")
+	if _, err := w.AddImage([]byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0}); err != nil {
+		t.Fatalf("AddImage: %v", err)
+	}
+	if err := w.WriteContents([]byte("<html><body>Alice was beginning to get very tired...</body></html>")); err != nil {
+		t.Fatalf("WriteContents: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
 func TestBasic(t *testing.T) {
-	b, err := Read(sampleFile)
+	b, err := ReadFH(bytes.NewReader(buildSampleBook(t)))
 	if err != nil {
-		t.Fatalf("Unable to open %q: %v", sampleFile, err)
+		t.Fatalf("ReadFH: %v", err)
+	}
+	if err := b.ReadAll(); err != nil {
+		t.Fatalf("ReadAll: %v", err)
 	}
 
 	// Did we decode the name right?
@@ -29,4 +54,9 @@ func TestBasic(t *testing.T) {
 	if len(b.Images) != 1 {
 		t.Errorf("Book image count error: got %v, want 1", len(b.Images))
 	}
+
+	// The EXTH header should have given us the author.
+	if b.Metadata == nil || b.Metadata.Author == "" {
+		t.Errorf("Book author error: expected a non-empty author, got %+v", b.Metadata)
+	}
 }
@@ -0,0 +1,154 @@
+package mobi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// recordCacheSize is the number of decoded text records kept around so
+// that Seeks within a small range don't re-run decompression.
+const recordCacheSize = 8
+
+// Resource describes a record in the book without materializing its
+// contents.
+type Resource struct {
+	// Index is the record's position in the underlying PDB.
+	Index int
+	// Kind is the record's type. Resources lists image records only,
+	// so it is always "image".
+	Kind string
+}
+
+// Resources lists the book's image records without reading them.
+func (m *Mobi) Resources() []Resource {
+	var rs []Resource
+	for i := int(m.header.FirstImage); i <= int(m.header.LastContentRecord) && i < len(m.pdb.Records); i++ {
+		if imageMagic(m.pdb.Records[i].Data) != "" {
+			rs = append(rs, Resource{Index: i, Kind: "image"})
+		}
+	}
+	return rs
+}
+
+// OpenImage returns a reader over the i'th image, as indexed into
+// Mobi.Images.
+func (m *Mobi) OpenImage(i int) (io.ReadSeekCloser, error) {
+	if i < 0 || i >= len(m.Images) {
+		return nil, fmt.Errorf("mobi: image index %v out of range", i)
+	}
+	return nopCloser{bytes.NewReader(m.Images[i])}, nil
+}
+
+// OpenText returns a reader over the book's decompressed text.
+// Records are decompressed on demand as the returned reader is read or
+// sought, with a small cache to keep repeated Seeks within a record
+// cheap. Decompression is lazy, but the underlying pdb.Pdb still holds
+// every record's raw bytes in memory: github.com/writingtoole/pdb
+// reads a file's full record data eagerly in ReadFH and has no
+// on-demand mode, so OpenText saves the cost of decompressing text you
+// never read, not the memory or I/O cost of the file itself.
+func (m *Mobi) OpenText() (io.ReadSeekCloser, error) {
+	return &textReader{m: m}, nil
+}
+
+// nopCloser adapts a *bytes.Reader to io.ReadSeekCloser.
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+// textReader implements io.ReadSeekCloser over a Mobi's book text,
+// decompressing PalmDOC/HUFF-CDIC records one at a time.
+type textReader struct {
+	m   *Mobi
+	pos int64
+
+	cacheIdx  []int
+	cacheData [][]byte
+}
+
+// record returns the decoded text of book text record idx, using and
+// maintaining the small LRU cache.
+func (r *textReader) record(idx int) ([]byte, error) {
+	for i, ci := range r.cacheIdx {
+		if ci == idx {
+			// Move the hit to the most-recently-used end.
+			data := r.cacheData[i]
+			copy(r.cacheIdx[i:], r.cacheIdx[i+1:])
+			r.cacheIdx[len(r.cacheIdx)-1] = idx
+			copy(r.cacheData[i:], r.cacheData[i+1:])
+			r.cacheData[len(r.cacheData)-1] = data
+			return data, nil
+		}
+	}
+
+	data, err := r.m.decodeRecord(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cacheIdx = append(r.cacheIdx, idx)
+	r.cacheData = append(r.cacheData, data)
+	if len(r.cacheIdx) > recordCacheSize {
+		r.cacheIdx = r.cacheIdx[1:]
+		r.cacheData = r.cacheData[1:]
+	}
+	return data, nil
+}
+
+func (r *textReader) Read(p []byte) (int, error) {
+	if r.pos >= r.m.textLength {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && r.pos < r.m.textLength {
+		recIdx := 1 + int(r.pos/int64(r.m.recordSize))
+		within := r.pos % int64(r.m.recordSize)
+
+		data, err := r.record(recIdx)
+		if err != nil {
+			return n, err
+		}
+		if within >= int64(len(data)) {
+			// Short final record; nothing more to read from it.
+			break
+		}
+
+		copied := copy(p[n:], data[within:])
+		n += copied
+		r.pos += int64(copied)
+	}
+
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (r *textReader) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = r.pos + offset
+	case io.SeekEnd:
+		newPos = r.m.textLength + offset
+	default:
+		return 0, fmt.Errorf("mobi: invalid whence %v", whence)
+	}
+	if newPos < 0 {
+		return 0, fmt.Errorf("mobi: negative seek position")
+	}
+	r.pos = newPos
+	return r.pos, nil
+}
+
+func (r *textReader) Close() error {
+	r.cacheIdx = nil
+	r.cacheData = nil
+	return nil
+}
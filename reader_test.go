@@ -0,0 +1,57 @@
+package mobi
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestOpenTextStreaming(t *testing.T) {
+	contents := []byte("<html><body>Hello, streaming world!</body></html>")
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetName("Streaming Test")
+	if err := w.WriteContents(contents); err != nil {
+		t.Fatalf("WriteContents: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	b, err := ReadFH(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("round-trip Read: %v", err)
+	}
+
+	// Parse should not have eagerly decoded the text.
+	if b.Contents != nil {
+		t.Errorf("Contents = %q, want nil before ReadAll", b.Contents)
+	}
+
+	tr, err := b.OpenText()
+	if err != nil {
+		t.Fatalf("OpenText: %v", err)
+	}
+	defer tr.Close()
+
+	got, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatalf("reading text: %v", err)
+	}
+	if !bytes.Equal(got, contents) {
+		t.Errorf("OpenText contents = %q, want %q", got, contents)
+	}
+
+	// Seeking back to the start should replay the same bytes.
+	if _, err := tr.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	again, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatalf("reading text after seek: %v", err)
+	}
+	if !bytes.Equal(again, contents) {
+		t.Errorf("OpenText contents after seek = %q, want %q", again, contents)
+	}
+}
@@ -0,0 +1,272 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/writingtoole/pdb"
+)
+
+// textRecordSize is the maximum number of bytes of book text packed
+// into a single PalmDOC record before it is split.
+const textRecordSize = 4096
+
+// Writer builds a .mobi file, modeled on archive/tar.Writer and
+// archive/zip.Writer: configure the book with the Set* methods and
+// AddImage, supply the text with WriteContents, and call Close to
+// flush the PDB container to the underlying io.Writer.
+type Writer struct {
+	w io.Writer
+
+	name      string
+	author    string
+	publisher string
+	images    [][]byte
+	contents  []byte
+
+	closed bool
+}
+
+// NewWriter returns a Writer that writes a MOBI file to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// SetName sets the book's title.
+func (wr *Writer) SetName(name string) {
+	wr.name = name
+}
+
+// SetAuthor sets the book's author, recorded as EXTH record 100.
+func (wr *Writer) SetAuthor(author string) {
+	wr.author = author
+}
+
+// SetPublisher sets the book's publisher, recorded as EXTH record 101.
+func (wr *Writer) SetPublisher(publisher string) {
+	wr.publisher = publisher
+}
+
+// AddImage appends an image record to the book and returns its index.
+// Inline content can reference the image with the recindex that index
+// plus one produces, matching the Mobipocket <img recindex="N"> scheme.
+func (wr *Writer) AddImage(data []byte) (int, error) {
+	if wr.closed {
+		return 0, fmt.Errorf("mobi: Writer is closed")
+	}
+	wr.images = append(wr.images, data)
+	return len(wr.images) - 1, nil
+}
+
+// WriteContents sets the book's text. MOBI books hold a single text
+// file, so this replaces any contents set by a previous call.
+func (wr *Writer) WriteContents(data []byte) error {
+	if wr.closed {
+		return fmt.Errorf("mobi: Writer is closed")
+	}
+	wr.contents = data
+	return nil
+}
+
+// Close builds the PDB container and flushes it to the underlying
+// io.Writer. It is an error to call any other Writer method after
+// Close.
+func (wr *Writer) Close() error {
+	if wr.closed {
+		return fmt.Errorf("mobi: Writer already closed")
+	}
+	wr.closed = true
+
+	textRecords, err := wr.buildTextRecords()
+	if err != nil {
+		return fmt.Errorf("error building text records: %v", err)
+	}
+
+	firstNonBook := uint32(1 + len(textRecords))
+	firstImage := firstNonBook
+	// LastContentRecord is the index of the last actual content record
+	// (inclusive), not one past it; with no images that's the last text
+	// record, just before firstImage.
+	lastContent := firstImage - 1
+	if len(wr.images) > 0 {
+		lastContent = firstImage + uint32(len(wr.images)) - 1
+	}
+
+	record0, err := wr.buildRecord0(len(textRecords), firstNonBook, firstImage, uint16(lastContent))
+	if err != nil {
+		return fmt.Errorf("error building header record: %v", err)
+	}
+
+	p := &pdb.Pdb{Name: wr.name, Filetype: "BOOK", Creator: "MOBI"}
+	p.Records = append(p.Records, &pdb.Record{Data: record0})
+	for _, r := range textRecords {
+		p.Records = append(p.Records, &pdb.Record{Data: r})
+	}
+	for _, img := range wr.images {
+		p.Records = append(p.Records, &pdb.Record{Data: img})
+	}
+	// FLIS and FCIS placeholders. Readers that don't understand
+	// multi-compilation books ignore these, so empty placeholders are
+	// sufficient for a single-section book.
+	p.Records = append(p.Records, &pdb.Record{Data: flisPlaceholder()})
+	p.Records = append(p.Records, &pdb.Record{Data: fcisPlaceholder(uint32(len(wr.contents)))})
+
+	// UniqueID just needs to be distinct per record; the record's
+	// index satisfies pdb.Validate's duplicate check.
+	for i, r := range p.Records {
+		r.UniqueID = uint32(i)
+	}
+
+	return p.WriteFH(wr.w)
+}
+
+// buildTextRecords splits the book's contents into textRecordSize
+// chunks and compresses each with the CompressionPalmDOC codec
+// registered in the codec registry.
+func (wr *Writer) buildTextRecords() ([][]byte, error) {
+	c, ok := compressor(CompressionPalmDOC)
+	if !ok {
+		return nil, fmt.Errorf("no compressor registered for CompressionPalmDOC")
+	}
+
+	var records [][]byte
+	for off := 0; off < len(wr.contents); off += textRecordSize {
+		end := off + textRecordSize
+		if end > len(wr.contents) {
+			end = len(wr.contents)
+		}
+
+		buf := &bytes.Buffer{}
+		wc, err := c(buf)
+		if err != nil {
+			return nil, fmt.Errorf("error creating compressor: %v", err)
+		}
+		if _, err := wc.Write(wr.contents[off:end]); err != nil {
+			return nil, fmt.Errorf("error compressing record: %v", err)
+		}
+		if err := wc.Close(); err != nil {
+			return nil, fmt.Errorf("error flushing compressed record: %v", err)
+		}
+		records = append(records, buf.Bytes())
+	}
+	if len(records) == 0 {
+		records = append(records, []byte{})
+	}
+	return records, nil
+}
+
+// buildRecord0 assembles the PalmDOC header, the MOBI header, the
+// EXTH block, and the book name into the first PDB record.
+func (wr *Writer) buildRecord0(textRecordCount int, firstNonBook, firstImage uint32, lastContent uint16) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	h := header{
+		Compression: CompressionPalmDOC,
+		TextLength:  uint32(len(wr.contents)),
+		RecordCount: uint16(textRecordCount),
+		RecordSize:  textRecordSize,
+	}
+	if err := binary.Write(buf, binary.BigEndian, &h); err != nil {
+		return nil, err
+	}
+
+	exth := wr.buildEXTH()
+
+	nameOffset := uint32(24+mhdSize) + uint32(len(exth))
+	mhd := &mobiHeaderData{
+		MobiType:          TypeMobipocket,
+		TextEncoding:      EncodingUTF8,
+		FirstNonBookRecord: firstNonBook,
+		NameOffset:        nameOffset,
+		NameLength:        uint32(len(wr.name)),
+		FirstImage:        firstImage,
+		EXTHFlags:         0x40,
+		FirstTextRecord:   1,
+		LastContentRecord: lastContent,
+	}
+
+	mhi := mobiHeaderID{Identifier: [4]byte{'M', 'O', 'B', 'I'}, HeaderLength: mhdSize}
+	if err := binary.Write(buf, binary.BigEndian, &mhi); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.BigEndian, mhd); err != nil {
+		return nil, err
+	}
+	buf.Write(exth)
+	buf.WriteString(wr.name)
+
+	return buf.Bytes(), nil
+}
+
+// buildEXTH emits an EXTH header followed by the EXTH records derived
+// from the Set* fields, padded to a multiple of 4 bytes as required by
+// the format.
+func (wr *Writer) buildEXTH() []byte {
+	type exthField struct {
+		id   uint32
+		data []byte
+	}
+	var fields []exthField
+	if wr.author != "" {
+		fields = append(fields, exthField{100, []byte(wr.author)})
+	}
+	if wr.publisher != "" {
+		fields = append(fields, exthField{101, []byte(wr.publisher)})
+	}
+
+	body := &bytes.Buffer{}
+	for _, f := range fields {
+		length := uint32(8 + len(f.data))
+		binary.Write(body, binary.BigEndian, f.id)
+		binary.Write(body, binary.BigEndian, length)
+		body.Write(f.data)
+	}
+
+	headerLength := uint32(12 + body.Len())
+	pad := (4 - headerLength%4) % 4
+	headerLength += pad
+
+	out := &bytes.Buffer{}
+	out.WriteString("EXTH")
+	binary.Write(out, binary.BigEndian, headerLength)
+	binary.Write(out, binary.BigEndian, uint32(len(fields)))
+	out.Write(body.Bytes())
+	out.Write(make([]byte, pad))
+	return out.Bytes()
+}
+
+// flisPlaceholder returns a minimal, single-section FLIS record.
+func flisPlaceholder() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("FLIS")
+	binary.Write(buf, binary.BigEndian, uint32(8))  // header length
+	binary.Write(buf, binary.BigEndian, uint16(65)) // flis type
+	binary.Write(buf, binary.BigEndian, uint16(0))
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	binary.Write(buf, binary.BigEndian, uint32(1))
+	binary.Write(buf, binary.BigEndian, uint16(3))
+	binary.Write(buf, binary.BigEndian, uint16(3))
+	binary.Write(buf, binary.BigEndian, uint32(1))
+	binary.Write(buf, binary.BigEndian, uint32(0xFFFFFFFF))
+	return buf.Bytes()
+}
+
+// fcisPlaceholder returns a minimal, single-section FCIS record
+// describing textLength bytes of text.
+func fcisPlaceholder(textLength uint32) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("FCIS")
+	binary.Write(buf, binary.BigEndian, uint32(20)) // header length
+	binary.Write(buf, binary.BigEndian, uint32(16))
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	binary.Write(buf, binary.BigEndian, textLength)
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	binary.Write(buf, binary.BigEndian, uint32(32))
+	binary.Write(buf, binary.BigEndian, uint16(8))
+	binary.Write(buf, binary.BigEndian, uint16(1))
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	return buf.Bytes()
+}
@@ -0,0 +1,45 @@
+package mobi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	const name = "Test Book"
+	contents := []byte("<html><body>Hello, world!</body></html>")
+	image := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0}
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetName(name)
+	w.SetAuthor("A. Writer")
+	if _, err := w.AddImage(image); err != nil {
+		t.Fatalf("AddImage: %v", err)
+	}
+	if err := w.WriteContents(contents); err != nil {
+		t.Fatalf("WriteContents: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	b, err := ReadFH(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("round-trip Read: %v", err)
+	}
+	if err := b.ReadAll(); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+
+	if b.Name != name {
+		t.Errorf("Name = %q, want %q", b.Name, name)
+	}
+	if !bytes.Equal(b.Contents, contents) {
+		t.Errorf("Contents = %q, want %q", b.Contents, contents)
+	}
+
+	if len(b.Images) != 1 || !bytes.Equal(b.Images[0], image) {
+		t.Errorf("Images = %v, want [%v]", b.Images, image)
+	}
+}